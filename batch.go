@@ -0,0 +1,133 @@
+package ipapk
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Result is the outcome of parsing a single file in a batch: exactly one of
+// Info or Err is set. Reporting failures this way, instead of a single
+// error for the whole batch, lets a caller scanning hundreds of artifacts
+// skip over the handful that don't parse instead of losing the rest.
+type Result struct {
+	Path string
+	Info *AppInfo
+	Err  error
+}
+
+// ParseAll parses every path in paths concurrently, using a pool of
+// concurrency workers (runtime.NumCPU() when concurrency <= 0), and streams
+// a Result for each file on the returned channel as soon as it is ready.
+// The channel is closed once every path has been parsed. Each AppInfo is
+// produced by NewAppParser, so it keeps its file open for lazy APIs such as
+// Icons and Provisioning; callers are responsible for calling Close on it.
+func ParseAll(paths []string, concurrency int) (<-chan Result, error) {
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+
+	jobs := make(chan string)
+	results := make(chan Result)
+
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				info, err := NewAppParser(path)
+				if err != nil {
+					results <- Result{Path: path, Err: err}
+					continue
+				}
+				results <- Result{Path: path, Info: info}
+			}
+		}()
+	}
+
+	go func() {
+		for _, p := range paths {
+			jobs <- p
+		}
+		close(jobs)
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results, nil
+}
+
+var appFileExts = map[string]bool{
+	androidExt: true,
+	iosExt:     true,
+}
+
+// ScanOptions configures ParseDir.
+type ScanOptions struct {
+	// Concurrency is the number of files parsed at once. It defaults to
+	// runtime.NumCPU() when <= 0.
+	Concurrency int
+
+	// SkipIcons skips the icon-decoding pass ParseDir otherwise runs
+	// up front. Icons are the slowest part of parsing an APK or IPA
+	// (iospng.PngRevertOptimization and Android resource-table walks),
+	// so callers that only need metadata such as BundleId and Version
+	// can skip it for a much faster scan.
+	SkipIcons bool
+}
+
+// ParseDir walks dir for .apk/.ipa files, such as a build server's output
+// directory, and parses them all in parallel through ParseAll. It returns
+// every AppInfo that parsed successfully; a file that fails to parse, or
+// whose icons fail to decode, is recorded in the returned error instead of
+// discarding the rest of the scan. As with ParseAll, each returned AppInfo
+// keeps its backing file open for lazy APIs such as Icons and Provisioning;
+// callers are responsible for calling Close on every one once done with it.
+func ParseDir(dir string, opts ScanOptions) ([]*AppInfo, error) {
+	var paths []string
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		if appFileExts[strings.ToLower(filepath.Ext(path))] {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed walking %v: %v", dir, err)
+	}
+
+	results, err := ParseAll(paths, opts.Concurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []*AppInfo
+	var errs []error
+	for r := range results {
+		if r.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", r.Path, r.Err))
+			continue
+		}
+		if !opts.SkipIcons {
+			if _, err := r.Info.Icons(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", r.Path, err))
+			}
+		}
+		infos = append(infos, r.Info)
+	}
+
+	return infos, errors.Join(errs...)
+}
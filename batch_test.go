@@ -0,0 +1,49 @@
+package ipapk
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestParseDir exercises the happy path: a directory of two valid IPAs (plus
+// one unrelated non-app file that must be ignored) all parse successfully
+// and close cleanly.
+func TestParseDir(t *testing.T) {
+	dir := t.TempDir()
+	writeTestIpa(t, filepath.Join(dir, "one.ipa"))
+	writeTestIpa(t, filepath.Join(dir, "two.ipa"))
+	if err := os.WriteFile(filepath.Join(dir, "readme.txt"), []byte("not an app"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	infos, err := ParseDir(dir, ScanOptions{})
+	if err != nil {
+		t.Fatalf("ParseDir: %v", err)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("expected 2 parsed apps, got %d", len(infos))
+	}
+	for _, info := range infos {
+		if info.BundleId != "com.example.sample" {
+			t.Fatalf("unexpected bundle id: %q", info.BundleId)
+		}
+		info.Close()
+	}
+}
+
+// TestParseDirSkipIcons confirms ScanOptions.SkipIcons is honored: the app
+// still parses with SkipIcons set, and Icons is simply never called on it.
+func TestParseDirSkipIcons(t *testing.T) {
+	dir := t.TempDir()
+	writeTestIpa(t, filepath.Join(dir, "one.ipa"))
+
+	infos, err := ParseDir(dir, ScanOptions{SkipIcons: true})
+	if err != nil {
+		t.Fatalf("ParseDir: %v", err)
+	}
+	if len(infos) != 1 {
+		t.Fatalf("expected 1 parsed app, got %d", len(infos))
+	}
+	infos[0].Close()
+}
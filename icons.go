@@ -0,0 +1,247 @@
+package ipapk
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/DHowett/go-plist"
+	"github.com/andrianbdn/iospng"
+	"github.com/shogo82148/androidbinary"
+)
+
+// IconVariant is a single rendered app icon, along with the metadata that
+// selected it: resource density on Android, or idiom/scale on iOS.
+type IconVariant struct {
+	Width  int
+	Height int
+
+	// Density is set for Android icons, taken from the resource
+	// table config (e.g. 160 for mdpi, 480 for xxhdpi).
+	Density int
+
+	// Scale and Idiom are set for iOS icons, parsed from the
+	// @2x/@3x file suffix and CFBundleIcons in Info.plist.
+	Scale int
+	Idiom string
+
+	Image image.Image
+}
+
+// Android density buckets, in android.util.DisplayMetrics units.
+const (
+	densityMDPI    = 160
+	densityHDPI    = 240
+	densityXHDPI   = 320
+	densityXXHDPI  = 480
+	densityXXXHDPI = 640
+)
+
+var androidIconDensities = []int{densityMDPI, densityHDPI, densityXHDPI, densityXXHDPI, densityXXXHDPI}
+
+var (
+	reIosIconFile = regexp.MustCompile(`Payload/[^/]+\.app/AppIcon[\w@.-]*\.png$`)
+	reIosIconDims = regexp.MustCompile(`AppIcon(\d+)x(\d+)(@(\d+)x)?`)
+)
+
+type iosIconFiles struct {
+	CFBundleIconFiles []string `plist:"CFBundleIconFiles"`
+}
+
+type iosIconSet struct {
+	CFBundlePrimaryIcon iosIconFiles `plist:"CFBundlePrimaryIcon"`
+}
+
+type iosIconsPlist struct {
+	CFBundleIcons     iosIconSet `plist:"CFBundleIcons"`
+	CFBundleIconsIpad iosIconSet `plist:"CFBundleIcons~ipad"`
+}
+
+// Icons returns every icon variant embedded in the APK/IPA, rather than a
+// single best-guess image. It requires a.zip,
+// which is only set when a was produced by one of the NewAppParser* funcs.
+func (a *AppInfo) Icons() ([]IconVariant, error) {
+	if a.zip == nil {
+		return nil, errors.New("ipapk: app was not parsed from a zip reader")
+	}
+
+	switch a.ext {
+	case androidExt:
+		return androidIcons(a.zip)
+	case iosExt:
+		return iosIcons(a.zip)
+	default:
+		return nil, errors.New("unknown platform")
+	}
+}
+
+// BestIcon returns the smallest icon variant whose width and height are both
+// at least minPx, falling back to the largest available variant if none are
+// big enough. It returns the zero IconVariant if no icons could be parsed.
+func (a *AppInfo) BestIcon(minPx int) IconVariant {
+	icons, err := a.Icons()
+	if err != nil || len(icons) == 0 {
+		return IconVariant{}
+	}
+
+	best := icons[0]
+	for _, ic := range icons[1:] {
+		switch {
+		case ic.Width >= minPx && ic.Height >= minPx &&
+			(best.Width < minPx || best.Height < minPx || ic.Width < best.Width):
+			best = ic
+		case best.Width < minPx || best.Height < minPx:
+			if ic.Width > best.Width {
+				best = ic
+			}
+		}
+	}
+	return best
+}
+
+func androidIcons(reader *zip.Reader) ([]IconVariant, error) {
+	manifest, _, err := loadApkManifest(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var variants []IconVariant
+	seen := make(map[string]bool)
+	for _, density := range androidIconDensities {
+		iconPath, err := manifest.App.Icon.WithResTableConfig(&androidbinary.ResTableConfig{
+			Density: uint16(density),
+		}).String()
+		if err != nil || androidbinary.IsResID(iconPath) || seen[iconPath] {
+			continue
+		}
+		seen[iconPath] = true
+
+		f := findZipFile(reader, iconPath)
+		if f == nil {
+			continue
+		}
+		data, err := readZipFile(f)
+		if err != nil {
+			continue
+		}
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			continue
+		}
+
+		b := img.Bounds()
+		variants = append(variants, IconVariant{
+			Width:   b.Dx(),
+			Height:  b.Dy(),
+			Density: density,
+			Image:   img,
+		})
+	}
+
+	if len(variants) == 0 {
+		return nil, errors.New("no icons found")
+	}
+	return variants, nil
+}
+
+func iosIcons(reader *zip.Reader) ([]IconVariant, error) {
+	var plistFile *zip.File
+	for _, f := range reader.File {
+		if reInfoPlist.MatchString(f.Name) {
+			plistFile = f
+			break
+		}
+	}
+	if plistFile == nil {
+		return nil, errors.New("info.plist is not found")
+	}
+
+	buf, err := readZipFile(plistFile)
+	if err != nil {
+		return nil, err
+	}
+	iconSet := new(iosIconsPlist)
+	decoder := plist.NewDecoder(bytes.NewReader(buf))
+	// CFBundleIcons is optional: older Info.plists without a modern
+	// asset catalog simply leave every icon tagged as idiom "iphone".
+	_ = decoder.Decode(iconSet)
+
+	ipadFiles := toIconFileSet(iconSet.CFBundleIconsIpad.CFBundlePrimaryIcon.CFBundleIconFiles)
+	iphoneFiles := toIconFileSet(iconSet.CFBundleIcons.CFBundlePrimaryIcon.CFBundleIconFiles)
+
+	var variants []IconVariant
+	for _, f := range reader.File {
+		if !reIosIconFile.MatchString(f.Name) {
+			continue
+		}
+
+		img, err := decodeIosIcon(f)
+		if err != nil {
+			continue
+		}
+
+		base := filepath.Base(f.Name)
+		scale := 1
+		if m := reIosIconDims.FindStringSubmatch(base); m != nil && m[4] != "" {
+			if s, err := strconv.Atoi(m[4]); err == nil {
+				scale = s
+			}
+		}
+
+		key := strings.TrimSuffix(base, filepath.Ext(base))
+		key = strings.SplitN(key, "@", 2)[0]
+		idiom := "iphone"
+		if ipadFiles[key] && !iphoneFiles[key] {
+			idiom = "ipad"
+		}
+
+		b := img.Bounds()
+		variants = append(variants, IconVariant{
+			Width:  b.Dx(),
+			Height: b.Dy(),
+			Scale:  scale,
+			Idiom:  idiom,
+			Image:  img,
+		})
+	}
+
+	if len(variants) == 0 {
+		return nil, errors.New("no icons found")
+	}
+	return variants, nil
+}
+
+func toIconFileSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, n := range names {
+		set[n] = true
+	}
+	return set
+}
+
+func decodeIosIcon(f *zip.File) (image.Image, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed opening icon file: %v", err)
+	}
+	defer rc.Close()
+
+	var w bytes.Buffer
+	err = iospng.PngRevertOptimization(rc, &w)
+	// BUG(@bzon): can't read sample ipa built from
+	// from https://github.com/browserstack/xcuitest-sample-browserstack
+	if err == iospng.ErrImageData {
+		return png.Decode(bytes.NewReader(w.Bytes()))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed png revert optimization: %v", err)
+	}
+	return png.Decode(bytes.NewReader(w.Bytes()))
+}
@@ -0,0 +1,89 @@
+package ipapk
+
+import (
+	"fmt"
+	"image"
+	"net/url"
+
+	"github.com/DHowett/go-plist"
+	"github.com/skip2/go-qrcode"
+)
+
+// otaManifest mirrors the plist structure Apple's OTA install mechanism
+// expects at the URL referenced by an itms-services:// link.
+// See: https://developer.apple.com/library/archive/documentation/NetworkingInternet/Conceptual/iPhoneOTAEnterprise/Introduction/Introduction.html
+type otaManifest struct {
+	Items []otaManifestItem `plist:"items"`
+}
+
+type otaManifestItem struct {
+	Assets   []otaManifestAsset  `plist:"assets"`
+	Metadata otaManifestMetadata `plist:"metadata"`
+}
+
+type otaManifestAsset struct {
+	Kind string `plist:"kind"`
+	URL  string `plist:"url"`
+}
+
+type otaManifestMetadata struct {
+	BundleIdentifier string `plist:"bundle-identifier"`
+	BundleVersion    string `plist:"bundle-version"`
+	Kind             string `plist:"kind"`
+	Title            string `plist:"title"`
+}
+
+// OTAManifest builds the Apple OTA install manifest.plist for a, pointing at
+// ipaURL for the package itself and, optionally, displayIconURL/fullIconURL
+// for the icons shown on the install confirmation alert and home screen.
+// displayIconURL and fullIconURL may be left empty if no hosted icon is
+// available.
+func (a *AppInfo) OTAManifest(ipaURL, displayIconURL, fullIconURL string) ([]byte, error) {
+	if ipaURL == "" {
+		return nil, fmt.Errorf("ipaURL is required")
+	}
+
+	assets := []otaManifestAsset{
+		{Kind: "software-package", URL: ipaURL},
+	}
+	if displayIconURL != "" {
+		assets = append(assets, otaManifestAsset{Kind: "display-image", URL: displayIconURL})
+	}
+	if fullIconURL != "" {
+		assets = append(assets, otaManifestAsset{Kind: "full-size-image", URL: fullIconURL})
+	}
+
+	manifest := otaManifest{
+		Items: []otaManifestItem{
+			{
+				Assets: assets,
+				Metadata: otaManifestMetadata{
+					BundleIdentifier: a.BundleId,
+					BundleVersion:    a.Version,
+					Kind:             "software",
+					Title:            a.Name,
+				},
+			},
+		},
+	}
+
+	buf, err := plist.Marshal(manifest, plist.XMLFormat)
+	if err != nil {
+		return nil, fmt.Errorf("failed marshaling ota manifest: %v", err)
+	}
+	return buf, nil
+}
+
+// InstallQRCode renders a QR code encoding the itms-services:// link that
+// triggers an OTA install from manifestURL, the public HTTPS URL the
+// manifest produced by OTAManifest is hosted at. size is both the width and
+// height of the returned square image, in pixels.
+func (a *AppInfo) InstallQRCode(manifestURL string, size int) (image.Image, error) {
+	link := fmt.Sprintf("itms-services://?action=download-manifest&url=%s", url.QueryEscape(manifestURL))
+
+	qr, err := qrcode.New(link, qrcode.Medium)
+	if err != nil {
+		return nil, fmt.Errorf("failed generating qr code: %v", err)
+	}
+	return qr.Image(size), nil
+}
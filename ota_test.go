@@ -0,0 +1,98 @@
+package ipapk
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+
+	"github.com/DHowett/go-plist"
+)
+
+func TestOTAManifest(t *testing.T) {
+	a := &AppInfo{Name: "Sample", BundleId: "com.example.sample", Version: "1.2.3"}
+
+	buf, err := a.OTAManifest("https://example.com/app.ipa", "https://example.com/display.png", "https://example.com/full.png")
+	if err != nil {
+		t.Fatalf("OTAManifest: %v", err)
+	}
+
+	var got otaManifest
+	if _, err := plist.Unmarshal(buf, &got); err != nil {
+		t.Fatalf("failed decoding generated manifest: %v", err)
+	}
+
+	if len(got.Items) != 1 {
+		t.Fatalf("expected 1 item, got %d", len(got.Items))
+	}
+	item := got.Items[0]
+
+	if item.Metadata.BundleIdentifier != "com.example.sample" {
+		t.Fatalf("unexpected bundle-identifier: %q", item.Metadata.BundleIdentifier)
+	}
+	if item.Metadata.BundleVersion != "1.2.3" {
+		t.Fatalf("unexpected bundle-version: %q", item.Metadata.BundleVersion)
+	}
+	if item.Metadata.Kind != "software" {
+		t.Fatalf("unexpected kind: %q", item.Metadata.Kind)
+	}
+	if item.Metadata.Title != "Sample" {
+		t.Fatalf("unexpected title: %q", item.Metadata.Title)
+	}
+
+	wantAssets := map[string]string{
+		"software-package": "https://example.com/app.ipa",
+		"display-image":    "https://example.com/display.png",
+		"full-size-image":  "https://example.com/full.png",
+	}
+	if len(item.Assets) != len(wantAssets) {
+		t.Fatalf("expected %d assets, got %d", len(wantAssets), len(item.Assets))
+	}
+	for _, asset := range item.Assets {
+		if wantAssets[asset.Kind] != asset.URL {
+			t.Fatalf("unexpected url for asset kind %q: %q", asset.Kind, asset.URL)
+		}
+	}
+}
+
+func TestOTAManifestRequiresIpaURL(t *testing.T) {
+	a := &AppInfo{Name: "Sample", BundleId: "com.example.sample", Version: "1.0"}
+	if _, err := a.OTAManifest("", "", ""); err == nil {
+		t.Fatal("expected an error when ipaURL is empty")
+	}
+}
+
+func TestOTAManifestWithoutIcons(t *testing.T) {
+	a := &AppInfo{Name: "Sample", BundleId: "com.example.sample", Version: "1.0"}
+
+	buf, err := a.OTAManifest("https://example.com/app.ipa", "", "")
+	if err != nil {
+		t.Fatalf("OTAManifest: %v", err)
+	}
+
+	var got otaManifest
+	if _, err := plist.Unmarshal(buf, &got); err != nil {
+		t.Fatalf("failed decoding generated manifest: %v", err)
+	}
+	if len(got.Items[0].Assets) != 1 {
+		t.Fatalf("expected only the software-package asset, got %d", len(got.Items[0].Assets))
+	}
+}
+
+func TestInstallQRCode(t *testing.T) {
+	a := &AppInfo{}
+
+	img, err := a.InstallQRCode("https://example.com/manifest.plist", 128)
+	if err != nil {
+		t.Fatalf("InstallQRCode: %v", err)
+	}
+
+	bounds := img.Bounds()
+	if bounds.Dx() != 128 || bounds.Dy() != 128 {
+		t.Fatalf("expected a 128x128 image, got %dx%d", bounds.Dx(), bounds.Dy())
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed encoding qr code image: %v", err)
+	}
+}
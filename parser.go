@@ -6,16 +6,13 @@ import (
 	"encoding/xml"
 	"errors"
 	"fmt"
-	"image"
-	"image/png"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
-	"strings"
 
 	"github.com/DHowett/go-plist"
-	"github.com/andrianbdn/iospng"
 	"github.com/shogo82148/androidbinary"
 	"github.com/shogo82148/androidbinary/apk"
 )
@@ -32,8 +29,12 @@ type AppInfo struct {
 	BundleId string
 	Version  string
 	Build    string
-	Icon     image.Image
 	Size     int64
+
+	zip    *zip.Reader
+	ext    string
+	raw    io.ReaderAt
+	closer io.Closer
 }
 
 type androidManifest struct {
@@ -50,44 +51,79 @@ type iosPlist struct {
 	CFBundleIdentifier   string `plist:"CFBundleIdentifier"`
 }
 
+// NewAppParser parses the APK or IPA at name. The returned AppInfo keeps the
+// file open for lazy APIs such as Icons, Provisioning, and AndroidSignatures
+// that read additional zip entries on demand; call Close when done with it.
 func NewAppParser(name string) (*AppInfo, error) {
 	file, err := os.Open(name)
 	if err != nil {
 		return nil, fmt.Errorf("failed opening file: %v: %v", name, err)
 	}
-	defer file.Close()
 
 	stat, err := file.Stat()
 	if err != nil {
+		file.Close()
 		return nil, fmt.Errorf("failed getting file stat: %v", err)
 	}
 
-	reader, err := zip.NewReader(file, stat.Size())
+	info, err := NewAppParserFromReader(file, stat.Size(), filepath.Ext(stat.Name()))
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	info.closer = file
+	return info, nil
+}
+
+// NewAppParserFromReader parses an APK or IPA from r without requiring it to
+// live on disk, so callers can feed in bytes coming from HTTP uploads, S3
+// objects, or any other io.ReaderAt-backed source. ext must be ".apk" or
+// ".ipa" since there is no file name to infer it from. r must remain valid
+// for the lifetime of the returned AppInfo, since lazy APIs such as Icons,
+// Provisioning, and AndroidSignatures read additional zip entries from it on
+// demand.
+func NewAppParserFromReader(r io.ReaderAt, size int64, ext string) (*AppInfo, error) {
+	reader, err := zip.NewReader(r, size)
 	if err != nil {
 		return nil, fmt.Errorf("failed reading zip file: %v", err)
 	}
 
-	var xmlFile, plistFile, iosIconFile *zip.File
+	info, err := NewAppParserFromZip(reader, ext)
+	if err != nil {
+		return nil, err
+	}
+	info.Size = size
+	info.raw = r
+	return info, nil
+}
+
+// NewAppParserFromZip parses an APK or IPA from an already-opened zip.Reader,
+// so a single zip pass can be shared with callers that also need to inspect
+// other entries (icons, provisioning profiles, and so on).
+func NewAppParserFromZip(reader *zip.Reader, ext string) (*AppInfo, error) {
+	var xmlFile, plistFile *zip.File
 	for _, f := range reader.File {
 		switch {
 		case f.Name == "AndroidManifest.xml":
 			xmlFile = f
 		case reInfoPlist.MatchString(f.Name):
 			plistFile = f
-		case strings.Contains(f.Name, "AppIcon60x60"):
-			iosIconFile = f
 		}
 	}
 
-	ext := filepath.Ext(stat.Name())
-
 	if ext == androidExt {
 		info, err := parseApkFile(xmlFile)
-		icon, label, err := parseApkIconAndLabel(name)
+		if err != nil {
+			return nil, err
+		}
+		label, err := parseApkLabel(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing apk label: %v", err)
+		}
 		info.Name = label
-		info.Icon = icon
-		info.Size = stat.Size()
-		return info, err
+		info.zip = reader
+		info.ext = ext
+		return info, nil
 	}
 
 	if ext == iosExt {
@@ -95,13 +131,9 @@ func NewAppParser(name string) (*AppInfo, error) {
 		if err != nil {
 			return nil, err
 		}
-		icon, err := parseIpaIcon(iosIconFile)
-		if err != nil {
-			return nil, fmt.Errorf("failed parsing ipa icon file: %v", err)
-		}
-		info.Icon = icon
-		info.Size = stat.Size()
-		return info, err
+		info.zip = reader
+		info.ext = ext
+		return info, nil
 	}
 
 	return nil, errors.New("unknown platform")
@@ -150,23 +182,88 @@ func parseApkFile(xmlFile *zip.File) (*AppInfo, error) {
 	return info, nil
 }
 
-func parseApkIconAndLabel(name string) (image.Image, string, error) {
-	pkg, err := apk.OpenFile(name)
+// loadApkManifest decodes the binary AndroidManifest.xml and resources.arsc
+// entries of reader into the structures the apk package and androidbinary
+// resource resolution expect, without reopening the archive from disk.
+func loadApkManifest(reader *zip.Reader) (*apk.Manifest, *androidbinary.TableFile, error) {
+	var resFile, xmlFile *zip.File
+	for _, f := range reader.File {
+		switch f.Name {
+		case "resources.arsc":
+			resFile = f
+		case "AndroidManifest.xml":
+			xmlFile = f
+		}
+	}
+	if resFile == nil {
+		return nil, nil, errors.New("resources.arsc is not found")
+	}
+	if xmlFile == nil {
+		return nil, nil, errors.New("AndroidManifest.xml is not found")
+	}
+
+	resData, err := readZipFile(resFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	table, err := androidbinary.NewTableFile(bytes.NewReader(resData))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	xmlData, err := readZipFile(xmlFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	xmlContent, err := androidbinary.NewXMLFile(bytes.NewReader(xmlData))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	manifest := new(apk.Manifest)
+	if err := xmlContent.Decode(manifest, table, nil); err != nil {
+		return nil, nil, err
+	}
+
+	return manifest, table, nil
+}
+
+func parseApkLabel(reader *zip.Reader) (string, error) {
+	manifest, _, err := loadApkManifest(reader)
 	if err != nil {
-		return nil, "", err
+		return "", err
 	}
-	defer pkg.Close()
 
-	icon, _ := pkg.Icon(&androidbinary.ResTableConfig{
-		Density: 720,
-	})
-	if icon == nil {
-		return nil, "", errors.New("Icon is not found")
+	label, _ := manifest.App.Label.WithResTableConfig(nil).String()
+	return label, nil
+}
+
+// Close releases resources held by a. It is only necessary when a was
+// created by NewAppParser; it is a no-op otherwise, since ipapk does not
+// take ownership of a reader it did not open itself.
+func (a *AppInfo) Close() error {
+	if a.closer == nil {
+		return nil
 	}
+	return a.closer.Close()
+}
 
-	label, _ := pkg.Label(nil)
+func findZipFile(reader *zip.Reader, name string) *zip.File {
+	for _, f := range reader.File {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
 
-	return icon, label, nil
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
 }
 
 func parseIpaFile(plistFile *zip.File) (*AppInfo, error) {
@@ -203,33 +300,3 @@ func parseIpaFile(plistFile *zip.File) (*AppInfo, error) {
 
 	return info, nil
 }
-
-func parseIpaIcon(iconFile *zip.File) (image.Image, error) {
-
-	if iconFile == nil {
-		return nil, errors.New("Icon is not found")
-	}
-
-	rc, err := iconFile.Open()
-	if err != nil {
-		return nil, fmt.Errorf("Failed opening icon file: %v", err)
-	}
-	defer rc.Close()
-
-	var w bytes.Buffer
-	err = iospng.PngRevertOptimization(rc, &w)
-	// BUG(@bzon): can't read sample ipa built from
-	// from https://github.com/browserstack/xcuitest-sample-browserstack
-	if err == iospng.ErrImageData {
-		image, _ := png.Decode(bytes.NewReader(w.Bytes()))
-		return image, nil
-	}
-	if err != nil {
-		return nil, fmt.Errorf("failed png revert optimization: %v", err)
-	}
-	image, err := png.Decode(bytes.NewReader(w.Bytes()))
-	if err != nil {
-		return nil, fmt.Errorf("failed decoding png: %v", err)
-	}
-	return image, nil
-}
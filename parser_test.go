@@ -0,0 +1,91 @@
+package ipapk
+
+import (
+	"archive/zip"
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestIpa builds a minimal, valid IPA on disk: an Info.plist plus one
+// @2x icon, the same shape NewAppParser is handed in production.
+func writeTestIpa(t *testing.T, path string) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	w, err := zw.Create("Payload/Sample.app/Info.plist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0"><dict>
+	<key>CFBundleName</key><string>Sample</string>
+	<key>CFBundleVersion</key><string>1</string>
+	<key>CFBundleShortVersionString</key><string>1.0</string>
+	<key>CFBundleIdentifier</key><string>com.example.sample</string>
+</dict></plist>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, 60, 60))
+	for y := 0; y < 60; y++ {
+		for x := 0; x < 60; x++ {
+			img.Set(x, y, color.RGBA{R: 200, G: 50, B: 50, A: 255})
+		}
+	}
+	var pngBuf bytes.Buffer
+	if err := png.Encode(&pngBuf, img); err != nil {
+		t.Fatal(err)
+	}
+	iw, err := zw.Create("Payload/Sample.app/AppIcon60x60@2x.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := iw.Write(pngBuf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestNewAppParserIconsAfterClose is a regression test for the lazy zip
+// APIs NewAppParserFromZip's a.zip field enables (Icons, Provisioning,
+// AndroidSignatures): calling them on an AppInfo produced by the on-disk
+// NewAppParser(path) entry point must not fail with "file already closed".
+// That contract was broken for several requests in this series because
+// NewAppParser used to close its *os.File with defer before returning.
+func TestNewAppParserIconsAfterClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sample.ipa")
+	writeTestIpa(t, path)
+
+	info, err := NewAppParser(path)
+	if err != nil {
+		t.Fatalf("NewAppParser: %v", err)
+	}
+	defer info.Close()
+
+	icons, err := info.Icons()
+	if err != nil {
+		t.Fatalf("Icons: %v", err)
+	}
+	if len(icons) != 1 {
+		t.Fatalf("expected 1 icon, got %d", len(icons))
+	}
+	if icons[0].Width != 60 || icons[0].Height != 60 {
+		t.Fatalf("unexpected icon dimensions: %+v", icons[0])
+	}
+}
@@ -0,0 +1,52 @@
+package ipapk
+
+import (
+	"encoding/asn1"
+	"fmt"
+)
+
+// Minimal CMS/PKCS#7 SignedData structures, modeled only as far as ipapk
+// needs to reach a signed payload and its signer certificates. Signatures
+// are never cryptographically verified against these structures.
+
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"optional,explicit,tag:0"`
+}
+
+// content returns the actual payload of a ContentInfo. For contentType
+// data, Content.Bytes is the full OCTET STRING TLV wrapped inside the
+// explicit [0] tag (the asn1 package does not unwrap nested primitives on
+// its own), so it takes one more Unmarshal to reach the bytes themselves.
+func (c pkcs7ContentInfo) content() ([]byte, error) {
+	if len(c.Content.Bytes) == 0 {
+		return nil, nil
+	}
+	var octet asn1.RawValue
+	if _, err := asn1.Unmarshal(c.Content.Bytes, &octet); err != nil {
+		return nil, fmt.Errorf("failed parsing eContent: %v", err)
+	}
+	return octet.Bytes, nil
+}
+
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      pkcs7ContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+// parsePKCS7SignedData unwraps a CMS ContentInfo { contentType, content }
+// envelope and decodes its content as SignedData.
+func parsePKCS7SignedData(der []byte) (*pkcs7SignedData, error) {
+	var outer pkcs7ContentInfo
+	if _, err := asn1.Unmarshal(der, &outer); err != nil {
+		return nil, fmt.Errorf("failed parsing ContentInfo: %v", err)
+	}
+
+	var signedData pkcs7SignedData
+	if _, err := asn1.Unmarshal(outer.Content.Bytes, &signedData); err != nil {
+		return nil, fmt.Errorf("failed parsing SignedData: %v", err)
+	}
+	return &signedData, nil
+}
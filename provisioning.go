@@ -0,0 +1,143 @@
+package ipapk
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/DHowett/go-plist"
+)
+
+var reMobileProvision = regexp.MustCompile(`Payload/[^/]+\.app/embedded\.mobileprovision`)
+
+// Provisioning holds the code-signing metadata embedded in an IPA's
+// Payload/*.app/embedded.mobileprovision, plus the entitlements it grants.
+type Provisioning struct {
+	TeamIdentifier       []string
+	AppIDPrefix          []string
+	ExpirationDate       time.Time
+	ProvisionedDevices   []string
+	GetTaskAllow         bool
+	ProvisionsAllDevices bool
+	Entitlements         map[string]interface{}
+}
+
+// mobileProvisionPlist mirrors the subset of embedded.mobileprovision we
+// care about. Apple does not publish a schema for this file; field names
+// are taken from the plist keys observed in real provisioning profiles.
+type mobileProvisionPlist struct {
+	TeamIdentifier              []string               `plist:"TeamIdentifier"`
+	ApplicationIdentifierPrefix []string               `plist:"ApplicationIdentifierPrefix"`
+	ExpirationDate              time.Time              `plist:"ExpirationDate"`
+	ProvisionedDevices          []string               `plist:"ProvisionedDevices"`
+	ProvisionsAllDevices        bool                   `plist:"ProvisionsAllDevices"`
+	Entitlements                map[string]interface{} `plist:"Entitlements"`
+}
+
+// Provisioning parses the embedded.mobileprovision CMS envelope of an IPA
+// and returns its code-signing metadata. It is only available for apps
+// parsed by one of the NewAppParser* funcs, and only for IPAs.
+func (a *AppInfo) Provisioning() (*Provisioning, error) {
+	if a.zip == nil {
+		return nil, errors.New("ipapk: app was not parsed from a zip reader")
+	}
+	if a.ext != iosExt {
+		return nil, errors.New("ipapk: provisioning profiles are only available for IPAs")
+	}
+
+	var mpFile *zip.File
+	for _, f := range a.zip.File {
+		if reMobileProvision.MatchString(f.Name) {
+			mpFile = f
+			break
+		}
+	}
+	if mpFile == nil {
+		return nil, errors.New("embedded.mobileprovision is not found")
+	}
+
+	der, err := readZipFile(mpFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading embedded.mobileprovision: %v", err)
+	}
+
+	plistData, err := extractCMSContent(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing embedded.mobileprovision: %v", err)
+	}
+
+	p := new(mobileProvisionPlist)
+	decoder := plist.NewDecoder(bytes.NewReader(plistData))
+	if err := decoder.Decode(p); err != nil {
+		return nil, fmt.Errorf("failed decoding provisioning profile plist: %v", err)
+	}
+
+	return &Provisioning{
+		TeamIdentifier:       p.TeamIdentifier,
+		AppIDPrefix:          p.ApplicationIdentifierPrefix,
+		ExpirationDate:       p.ExpirationDate,
+		ProvisionedDevices:   p.ProvisionedDevices,
+		ProvisionsAllDevices: p.ProvisionsAllDevices,
+		GetTaskAllow:         entitlementBool(p.Entitlements, "get-task-allow"),
+		Entitlements:         p.Entitlements,
+	}, nil
+}
+
+// extractCMSContent reaches through a CMS/PKCS#7 SignedData envelope to
+// return its signed content, without verifying the signature.
+func extractCMSContent(der []byte) ([]byte, error) {
+	signedData, err := parsePKCS7SignedData(der)
+	if err != nil {
+		return nil, err
+	}
+	content, err := signedData.ContentInfo.content()
+	if err != nil {
+		return nil, err
+	}
+	if len(content) == 0 {
+		return nil, errors.New("embedded content is empty")
+	}
+	return content, nil
+}
+
+func entitlementBool(entitlements map[string]interface{}, key string) bool {
+	v, ok := entitlements[key].(bool)
+	return ok && v
+}
+
+// IsExpired reports whether a's provisioning profile has expired. It
+// returns false if the provisioning profile could not be parsed (e.g. for
+// an APK, or an App Store build that carries no embedded.mobileprovision).
+func (a *AppInfo) IsExpired() bool {
+	p, err := a.Provisioning()
+	if err != nil {
+		return false
+	}
+	return time.Now().After(p.ExpirationDate)
+}
+
+// DistributionType classifies a's provisioning profile as "development",
+// "ad-hoc", "enterprise", or "app-store", following the same signals Xcode
+// and fastlane use: get-task-allow, the provisioned device list, and
+// ProvisionsAllDevices. It returns "" if no provisioning profile could be
+// parsed.
+func (a *AppInfo) DistributionType() string {
+	p, err := a.Provisioning()
+	if err != nil {
+		return ""
+	}
+
+	switch {
+	case p.GetTaskAllow:
+		return "development"
+	case len(p.ProvisionedDevices) > 0:
+		return "ad-hoc"
+	case p.ProvisionsAllDevices:
+		return "enterprise"
+	default:
+		return "app-store"
+	}
+}
@@ -0,0 +1,203 @@
+package ipapk
+
+import (
+	"archive/zip"
+	"encoding/asn1"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// derLen DER-encodes a length, using the short form below 0x80 and the
+// minimal-width long form otherwise.
+func derLen(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var b []byte
+	for n > 0 {
+		b = append([]byte{byte(n)}, b...)
+		n >>= 8
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+// derTLV wraps content in a DER tag-length-value header.
+func derTLV(tag byte, content []byte) []byte {
+	out := append([]byte{tag}, derLen(len(content))...)
+	return append(out, content...)
+}
+
+// buildMobileProvisionDER hand-assembles a CMS/PKCS#7 SignedData envelope
+// around plistData, in the same shape Apple's `security cms -S` produces for
+// a real embedded.mobileprovision, but without a real signer: it carries no
+// signerInfos or certificates, since Provisioning only ever reaches through
+// the envelope for its content and never verifies the signature.
+func buildMobileProvisionDER(t *testing.T, plistData []byte) []byte {
+	t.Helper()
+
+	oidData, err := asn1.Marshal(asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oidSignedData, err := asn1.Marshal(asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := asn1.Marshal(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eContent := derTLV(0x04, plistData)        // OCTET STRING
+	eContentExplicit := derTLV(0xa0, eContent) // [0] EXPLICIT
+
+	var encapContentInfo []byte
+	encapContentInfo = append(encapContentInfo, oidData...)
+	encapContentInfo = append(encapContentInfo, eContentExplicit...)
+	encapContentInfoSeq := derTLV(0x30, encapContentInfo)
+
+	digestAlgorithms := derTLV(0x31, nil) // empty SET OF
+
+	var signedData []byte
+	signedData = append(signedData, version...)
+	signedData = append(signedData, digestAlgorithms...)
+	signedData = append(signedData, encapContentInfoSeq...)
+	signedDataSeq := derTLV(0x30, signedData)
+	signedDataExplicit := derTLV(0xa0, signedDataSeq)
+
+	var outer []byte
+	outer = append(outer, oidSignedData...)
+	outer = append(outer, signedDataExplicit...)
+	return derTLV(0x30, outer)
+}
+
+// writeTestIpaWithProvisioning builds a minimal IPA like writeTestIpa, plus
+// an embedded.mobileprovision whose CMS envelope wraps provisionPlist.
+func writeTestIpaWithProvisioning(t *testing.T, path string, provisionPlist []byte) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	w, err := zw.Create("Payload/Sample.app/Info.plist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0"><dict>
+	<key>CFBundleName</key><string>Sample</string>
+	<key>CFBundleVersion</key><string>1</string>
+	<key>CFBundleShortVersionString</key><string>1.0</string>
+	<key>CFBundleIdentifier</key><string>com.example.sample</string>
+</dict></plist>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mw, err := zw.Create("Payload/Sample.app/embedded.mobileprovision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mw.Write(buildMobileProvisionDER(t, provisionPlist)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProvisioning(t *testing.T) {
+	cases := []struct {
+		name             string
+		plist            string
+		wantExpired      bool
+		wantDistribution string
+	}{
+		{
+			name: "development",
+			plist: `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0"><dict>
+	<key>TeamIdentifier</key><array><string>ABCDE12345</string></array>
+	<key>ApplicationIdentifierPrefix</key><array><string>ABCDE12345</string></array>
+	<key>ExpirationDate</key><date>2099-01-01T00:00:00Z</date>
+	<key>ProvisionedDevices</key><array><string>device-1</string><string>device-2</string></array>
+	<key>ProvisionsAllDevices</key><false/>
+	<key>Entitlements</key><dict><key>get-task-allow</key><true/></dict>
+</dict></plist>`,
+			wantExpired:      false,
+			wantDistribution: "development",
+		},
+		{
+			name: "ad-hoc-expired",
+			plist: `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0"><dict>
+	<key>TeamIdentifier</key><array><string>ABCDE12345</string></array>
+	<key>ApplicationIdentifierPrefix</key><array><string>ABCDE12345</string></array>
+	<key>ExpirationDate</key><date>2000-01-01T00:00:00Z</date>
+	<key>ProvisionedDevices</key><array><string>device-1</string></array>
+	<key>ProvisionsAllDevices</key><false/>
+	<key>Entitlements</key><dict><key>get-task-allow</key><false/></dict>
+</dict></plist>`,
+			wantExpired:      true,
+			wantDistribution: "ad-hoc",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "sample.ipa")
+			writeTestIpaWithProvisioning(t, path, []byte(c.plist))
+
+			info, err := NewAppParser(path)
+			if err != nil {
+				t.Fatalf("NewAppParser: %v", err)
+			}
+			defer info.Close()
+
+			p, err := info.Provisioning()
+			if err != nil {
+				t.Fatalf("Provisioning: %v", err)
+			}
+			if len(p.TeamIdentifier) != 1 || p.TeamIdentifier[0] != "ABCDE12345" {
+				t.Fatalf("unexpected TeamIdentifier: %+v", p.TeamIdentifier)
+			}
+
+			if got := info.IsExpired(); got != c.wantExpired {
+				t.Fatalf("IsExpired: got %v, want %v", got, c.wantExpired)
+			}
+			if got := info.DistributionType(); got != c.wantDistribution {
+				t.Fatalf("DistributionType: got %q, want %q", got, c.wantDistribution)
+			}
+		})
+	}
+}
+
+func TestProvisioningNotFound(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sample.ipa")
+	writeTestIpa(t, path)
+
+	info, err := NewAppParser(path)
+	if err != nil {
+		t.Fatalf("NewAppParser: %v", err)
+	}
+	defer info.Close()
+
+	if _, err := info.Provisioning(); err == nil {
+		t.Fatal("expected an error for an IPA with no embedded.mobileprovision")
+	}
+	if info.IsExpired() {
+		t.Fatal("IsExpired should be false when no provisioning profile is present")
+	}
+	if got := info.DistributionType(); got != "" {
+		t.Fatalf(`expected "", got %q`, got)
+	}
+}
@@ -0,0 +1,555 @@
+package ipapk
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"regexp"
+	"time"
+)
+
+// Signing block scheme IDs, as assigned by the APK Signing Block format.
+// See: https://source.android.com/docs/security/features/apksigning/v2
+const (
+	sigSchemeV2BlockID uint32 = 0x7109871a
+	sigSchemeV3BlockID uint32 = 0xf05368c0
+)
+
+var apkSigBlockMagic = []byte("APK Sig Block 42")
+
+var reV1SignatureFile = regexp.MustCompile(`^META-INF/[^/]+\.(RSA|DSA|EC)$`)
+
+const apkChunkSize = 1024 * 1024
+
+// Certificate is a signer certificate extracted from an APK's signing
+// block (v2/v3) or a META-INF/*.{RSA,DSA,EC} PKCS#7 block (v1).
+type Certificate struct {
+	Subject           string
+	SHA1Fingerprint   string
+	SHA256Fingerprint string
+	NotBefore         time.Time
+	NotAfter          time.Time
+}
+
+// Signature is one signing scheme found in an APK, along with the
+// certificates that signed it. Verified reports whether the signer's
+// cryptographic signature over the signed-data block (digests +
+// certificates) validates against that signer's own public key, and
+// whether the recomputed content digest matches the one the signature
+// covers. The public key used is the one carried in the signer record; it
+// is not compared against the public key of any entry in Certificates. v1
+// signatures are never verified: only their certificates are extracted.
+type Signature struct {
+	Scheme       int
+	Certificates []Certificate
+	Verified     bool
+}
+
+// AndroidSignatures locates and parses the APK Signing Block (v2/v3),
+// falling back to META-INF/*.{RSA,DSA,EC} PKCS#7 blocks (v1) if no signing
+// block is present. It requires a to have been parsed from a random-access
+// reader, i.e. via NewAppParser or NewAppParserFromReader.
+func (a *AppInfo) AndroidSignatures() ([]Signature, error) {
+	if a.ext != androidExt {
+		return nil, errors.New("ipapk: android signatures are only available for APKs")
+	}
+	if a.raw == nil {
+		return nil, errors.New("ipapk: android signatures require a random-access reader; use NewAppParser or NewAppParserFromReader")
+	}
+
+	cdOffset, cdSize, eocd, eocdOffset, err := findEOCD(a.raw, a.Size)
+	if err != nil {
+		return nil, fmt.Errorf("failed locating end of central directory record: %v", err)
+	}
+
+	var sigs []Signature
+	blockStart, pairs, err := findApkSigningBlock(a.raw, cdOffset)
+	if err == nil {
+		for _, scheme := range []struct {
+			id      uint32
+			version int
+		}{
+			{sigSchemeV2BlockID, 2},
+			{sigSchemeV3BlockID, 3},
+		} {
+			value, ok := pairs[scheme.id]
+			if !ok {
+				continue
+			}
+			sig, err := parseSchemeSignature(scheme.version, value)
+			if err != nil {
+				continue
+			}
+			digestOK := verifySchemeDigest(a.raw, blockStart, cdOffset, cdSize, eocd, eocdOffset, sig.digestAlgorithm, sig.digest)
+			sig.Verified = digestOK && sig.signatureOK
+			sigs = append(sigs, sig.Signature)
+		}
+	}
+
+	if len(sigs) == 0 {
+		v1Sigs, err := parseV1Signatures(a.zip)
+		if err != nil {
+			return nil, err
+		}
+		sigs = v1Sigs
+	}
+
+	if len(sigs) == 0 {
+		return nil, errors.New("no APK signature found")
+	}
+	return sigs, nil
+}
+
+// findEOCD scans the final 64KiB (plus the fixed record size) of the
+// archive for the End of Central Directory record and returns the central
+// directory's offset and size, the raw EOCD record bytes, and the EOCD's
+// offset in the file.
+func findEOCD(r io.ReaderAt, size int64) (cdOffset int64, cdSize int64, eocd []byte, eocdOffset int64, err error) {
+	const maxCommentSize = 65535
+	const eocdFixedSize = 22
+
+	searchSize := int64(eocdFixedSize + maxCommentSize)
+	if searchSize > size {
+		searchSize = size
+	}
+
+	buf := make([]byte, searchSize)
+	if _, err := r.ReadAt(buf, size-searchSize); err != nil {
+		return 0, 0, nil, 0, err
+	}
+
+	for i := len(buf) - eocdFixedSize; i >= 0; i-- {
+		if buf[i] == 0x50 && buf[i+1] == 0x4b && buf[i+2] == 0x05 && buf[i+3] == 0x06 {
+			commentLen := int(binary.LittleEndian.Uint16(buf[i+20 : i+22]))
+			if i+eocdFixedSize+commentLen != len(buf) {
+				continue // not the real EOCD signature, just matching bytes in a comment
+			}
+			cdSize = int64(binary.LittleEndian.Uint32(buf[i+12 : i+16]))
+			cdOffset = int64(binary.LittleEndian.Uint32(buf[i+16 : i+20]))
+			eocdOffset = size - searchSize + int64(i)
+			record := make([]byte, eocdFixedSize+commentLen)
+			copy(record, buf[i:])
+			return cdOffset, cdSize, record, eocdOffset, nil
+		}
+	}
+	return 0, 0, nil, 0, errors.New("end of central directory record not found")
+}
+
+// findApkSigningBlock locates the APK Signing Block, which is sandwiched
+// between the zip entries and the central directory, and parses its
+// ID-value pairs.
+func findApkSigningBlock(r io.ReaderAt, cdOffset int64) (blockStart int64, pairs map[uint32][]byte, err error) {
+	if cdOffset < 24 {
+		return 0, nil, errors.New("file too small to contain a signing block")
+	}
+
+	footer := make([]byte, 24)
+	if _, err := r.ReadAt(footer, cdOffset-24); err != nil {
+		return 0, nil, err
+	}
+	if string(footer[8:24]) != string(apkSigBlockMagic) {
+		return 0, nil, errors.New("APK Signing Block magic not found")
+	}
+
+	blockSizeFooter := binary.LittleEndian.Uint64(footer[0:8])
+	blockTotalSize := int64(blockSizeFooter) + 8
+	blockStart = cdOffset - blockTotalSize
+	if blockStart < 0 {
+		return 0, nil, errors.New("APK Signing Block size field is corrupt")
+	}
+
+	header := make([]byte, 8)
+	if _, err := r.ReadAt(header, blockStart); err != nil {
+		return 0, nil, err
+	}
+	blockSizeHeader := binary.LittleEndian.Uint64(header)
+	if blockSizeHeader != blockSizeFooter {
+		return 0, nil, errors.New("APK Signing Block size fields do not match")
+	}
+
+	payloadLen := blockSizeFooter - 24
+	payload := make([]byte, payloadLen)
+	if _, err := r.ReadAt(payload, blockStart+8); err != nil {
+		return 0, nil, err
+	}
+
+	pairs = make(map[uint32][]byte)
+	for len(payload) > 0 {
+		if len(payload) < 8 {
+			return 0, nil, errors.New("APK Signing Block is truncated")
+		}
+		entryLen := binary.LittleEndian.Uint64(payload[:8])
+		payload = payload[8:]
+		if uint64(len(payload)) < entryLen || entryLen < 4 {
+			return 0, nil, errors.New("APK Signing Block entry is truncated")
+		}
+		id := binary.LittleEndian.Uint32(payload[:4])
+		pairs[id] = payload[4:entryLen]
+		payload = payload[entryLen:]
+	}
+
+	return blockStart, pairs, nil
+}
+
+// readLengthPrefixed consumes a uint32-length-prefixed slice from the front
+// of buf and returns it along with the remaining bytes.
+func readLengthPrefixed(buf []byte) (content, rest []byte, err error) {
+	if len(buf) < 4 {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	n := binary.LittleEndian.Uint32(buf[:4])
+	buf = buf[4:]
+	if uint64(len(buf)) < uint64(n) {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	return buf[:n], buf[n:], nil
+}
+
+// splitLengthPrefixed repeatedly applies readLengthPrefixed until seq is
+// consumed, returning each element in order.
+func splitLengthPrefixed(seq []byte) ([][]byte, error) {
+	var out [][]byte
+	for len(seq) > 0 {
+		elem, rest, err := readLengthPrefixed(seq)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, elem)
+		seq = rest
+	}
+	return out, nil
+}
+
+type schemeSignature struct {
+	Signature
+	digestAlgorithm uint32
+	digest          []byte
+	// signatureOK reports whether at least one signature in the signer's
+	// signatures section validated against signedData using the
+	// signer's own public key. It is combined with the content digest
+	// check to produce Signature.Verified.
+	signatureOK bool
+}
+
+// parseSchemeSignature decodes a v2 or v3 signing block value: a
+// length-prefixed sequence of signers, each carrying a signed-data block
+// (digests + certificates), a signatures block, and the signer's public
+// key.
+func parseSchemeSignature(version int, value []byte) (*schemeSignature, error) {
+	signerSeq, _, err := readLengthPrefixed(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading signer sequence: %v", err)
+	}
+	signers, err := splitLengthPrefixed(signerSeq)
+	if err != nil || len(signers) == 0 {
+		return nil, errors.New("no signers found")
+	}
+
+	// Only the first signer is surfaced: APK signing schemes allow
+	// multiple signers for key rotation, but a single signer is by far
+	// the common case and callers mainly care about "who signed this".
+	signedData, rest, err := readLengthPrefixed(signers[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed reading signed data: %v", err)
+	}
+	signaturesSeq, rest, err := readLengthPrefixed(rest)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading signatures: %v", err)
+	}
+	pubKeyDER, _, err := readLengthPrefixed(rest)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading public key: %v", err)
+	}
+
+	digestSeq, rest, err := readLengthPrefixed(signedData)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading digest sequence: %v", err)
+	}
+	certSeq, _, err := readLengthPrefixed(rest)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading certificate sequence: %v", err)
+	}
+
+	digests, err := splitLengthPrefixed(digestSeq)
+	if err != nil || len(digests) == 0 {
+		return nil, errors.New("no digests found")
+	}
+	algo, digest, err := parseDigest(digests[0])
+	if err != nil {
+		return nil, err
+	}
+
+	certDERs, err := splitLengthPrefixed(certSeq)
+	if err != nil || len(certDERs) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+
+	var certs []Certificate
+	for _, der := range certDERs {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			continue
+		}
+		certs = append(certs, newCertificate(cert))
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates could be parsed")
+	}
+
+	signatures, err := splitLengthPrefixed(signaturesSeq)
+	if err != nil || len(signatures) == 0 {
+		return nil, errors.New("no signatures found")
+	}
+	pubKey, err := x509.ParsePKIXPublicKey(pubKeyDER)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing public key: %v", err)
+	}
+
+	return &schemeSignature{
+		Signature: Signature{
+			Scheme:       version,
+			Certificates: certs,
+		},
+		digestAlgorithm: algo,
+		digest:          digest,
+		signatureOK:     verifySignedDataSignature(pubKey, signedData, signatures),
+	}, nil
+}
+
+// verifySignedDataSignature reports whether any signature record in
+// signatures is a valid signature, by pubKey, over signedData's raw bytes
+// (not a digest of signedData - the signer record carries its own digest
+// separately, but the scheme verifies the signature against the signed-data
+// bytes themselves). An APK Signing Block can carry several signature
+// algorithms for compatibility; accepting the first one that validates
+// matches the Android platform's own verifier.
+func verifySignedDataSignature(pubKey crypto.PublicKey, signedData []byte, signatures [][]byte) bool {
+	for _, record := range signatures {
+		if len(record) < 4 {
+			continue
+		}
+		algorithm := binary.LittleEndian.Uint32(record[:4])
+		sig, _, err := readLengthPrefixed(record[4:])
+		if err != nil {
+			continue
+		}
+		if verifyAlgorithmSignature(algorithm, pubKey, signedData, sig) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyAlgorithmSignature checks sig against signedData using pubKey,
+// per the digest/padding scheme the APK Signing Block algorithm ID
+// specifies. See: https://source.android.com/docs/security/features/apksigning/v2
+func verifyAlgorithmSignature(algorithm uint32, pubKey crypto.PublicKey, signedData, sig []byte) bool {
+	newHash, cryptoHash, ok := signatureHash(algorithm)
+	if !ok {
+		return false
+	}
+	h := newHash()
+	h.Write(signedData)
+	digest := h.Sum(nil)
+
+	switch key := pubKey.(type) {
+	case *rsa.PublicKey:
+		switch algorithm {
+		case 0x0101, 0x0102: // RSASSA-PSS
+			opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: cryptoHash}
+			return rsa.VerifyPSS(key, cryptoHash, digest, sig, opts) == nil
+		case 0x0103, 0x0104: // RSASSA-PKCS1-v1_5
+			return rsa.VerifyPKCS1v15(key, cryptoHash, digest, sig) == nil
+		default:
+			return false
+		}
+	case *ecdsa.PublicKey:
+		if algorithm != 0x0201 && algorithm != 0x0202 {
+			return false
+		}
+		return ecdsa.VerifyASN1(key, digest, sig)
+	case *dsa.PublicKey:
+		if algorithm != 0x0301 {
+			return false
+		}
+		var parsed dsaSignature
+		if _, err := asn1.Unmarshal(sig, &parsed); err != nil {
+			return false
+		}
+		return dsa.Verify(key, digest, parsed.R, parsed.S)
+	default:
+		return false
+	}
+}
+
+// dsaSignature mirrors the ASN.1 SEQUENCE{r, s INTEGER} a DSA signature is
+// encoded as.
+type dsaSignature struct {
+	R, S *big.Int
+}
+
+// signatureHash maps an APK Signing Block algorithm ID to the digest it
+// signs over. The same IDs are reused for the per-chunk content digest
+// algorithm (see contentDigestHash).
+func signatureHash(algorithm uint32) (newHash func() hash.Hash, cryptoHash crypto.Hash, ok bool) {
+	switch algorithm {
+	case 0x0101, 0x0103, 0x0201, 0x0301:
+		return sha256.New, crypto.SHA256, true
+	case 0x0102, 0x0104, 0x0202:
+		return sha512.New, crypto.SHA512, true
+	default:
+		return nil, 0, false
+	}
+}
+
+func parseDigest(buf []byte) (algorithm uint32, digest []byte, err error) {
+	if len(buf) < 4 {
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+	algorithm = binary.LittleEndian.Uint32(buf[:4])
+	digest, _, err = readLengthPrefixed(buf[4:])
+	return algorithm, digest, err
+}
+
+// verifySchemeDigest recomputes the APK Signing Block v2/v3 content digest
+// over the three required sections - zip entries, central directory, and
+// EOCD (with its central directory offset patched as if the signing block
+// were absent) - and compares it against the digest the signer claims.
+func verifySchemeDigest(r io.ReaderAt, blockStart, cdOffset, cdSize int64, eocd []byte, eocdOffset int64, algorithm uint32, wantDigest []byte) bool {
+	newHash, ok := contentDigestHash(algorithm)
+	if !ok {
+		return false
+	}
+
+	contents := io.NewSectionReader(r, 0, blockStart)
+	centralDir := io.NewSectionReader(r, cdOffset, cdSize)
+
+	patchedEOCD := make([]byte, len(eocd))
+	copy(patchedEOCD, eocd)
+	binary.LittleEndian.PutUint32(patchedEOCD[16:20], uint32(blockStart))
+
+	got, err := computeApkDigest(newHash, contents, centralDir, bytes.NewReader(patchedEOCD))
+	if err != nil {
+		return false
+	}
+	return hex.EncodeToString(got) == hex.EncodeToString(wantDigest)
+}
+
+func contentDigestHash(algorithm uint32) (func() hash.Hash, bool) {
+	newHash, _, ok := signatureHash(algorithm)
+	return newHash, ok
+}
+
+// computeApkDigest implements CONTENT_DIGEST_CHUNKED_SHA256/512: every
+// section is split into 1MiB chunks, each chunk is hashed with a 0xa5
+// prefix and its length, and the final digest hashes the concatenation of
+// chunk digests with a 0x5a prefix and the chunk count.
+func computeApkDigest(newHash func() hash.Hash, sections ...io.Reader) ([]byte, error) {
+	var chunkDigests []byte
+	chunkCount := 0
+
+	buf := make([]byte, apkChunkSize)
+	for _, section := range sections {
+		for {
+			n, err := io.ReadFull(section, buf)
+			if n > 0 {
+				h := newHash()
+				h.Write([]byte{0xa5})
+				var lenBuf [4]byte
+				binary.LittleEndian.PutUint32(lenBuf[:], uint32(n))
+				h.Write(lenBuf[:])
+				h.Write(buf[:n])
+				chunkDigests = append(chunkDigests, h.Sum(nil)...)
+				chunkCount++
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	top := newHash()
+	top.Write([]byte{0x5a})
+	var countBuf [4]byte
+	binary.LittleEndian.PutUint32(countBuf[:], uint32(chunkCount))
+	top.Write(countBuf[:])
+	top.Write(chunkDigests)
+	return top.Sum(nil), nil
+}
+
+// parseV1Signatures extracts signer certificates from the v1 (JAR signing)
+// META-INF/*.{RSA,DSA,EC} PKCS#7 blocks. Content is detached (these sign
+// META-INF/CERT.SF, not an embedded payload), so only certificate
+// extraction is attempted; the signature itself is not verified.
+func parseV1Signatures(reader *zip.Reader) ([]Signature, error) {
+	if reader == nil {
+		return nil, errors.New("ipapk: app was not parsed from a zip reader")
+	}
+
+	var sigs []Signature
+	for _, f := range reader.File {
+		if !reV1SignatureFile.MatchString(f.Name) {
+			continue
+		}
+
+		der, err := readZipFile(f)
+		if err != nil {
+			continue
+		}
+
+		signedData, err := parsePKCS7SignedData(der)
+		if err != nil {
+			continue
+		}
+
+		certs, err := x509.ParseCertificates(signedData.Certificates.Bytes)
+		if err != nil || len(certs) == 0 {
+			continue
+		}
+
+		var certificates []Certificate
+		for _, cert := range certs {
+			certificates = append(certificates, newCertificate(cert))
+		}
+
+		sigs = append(sigs, Signature{
+			Scheme:       1,
+			Certificates: certificates,
+		})
+	}
+
+	if len(sigs) == 0 {
+		return nil, errors.New("no v1 signature blocks found")
+	}
+	return sigs, nil
+}
+
+func newCertificate(cert *x509.Certificate) Certificate {
+	sha1sum := sha1.Sum(cert.Raw)
+	sha256sum := sha256.Sum256(cert.Raw)
+	return Certificate{
+		Subject:           cert.Subject.String(),
+		SHA1Fingerprint:   hex.EncodeToString(sha1sum[:]),
+		SHA256Fingerprint: hex.EncodeToString(sha256sum[:]),
+		NotBefore:         cert.NotBefore,
+		NotAfter:          cert.NotAfter,
+	}
+}
@@ -0,0 +1,386 @@
+package ipapk
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// marshalDSAPublicKey builds a PKIX SubjectPublicKeyInfo DER encoding for a
+// DSA public key. crypto/x509.MarshalPKIXPublicKey has never supported DSA
+// (only ParsePKIXPublicKey does, for legacy certificates), so tests that
+// need a DSA signer's public key in that form build it by hand.
+func marshalDSAPublicKey(pub *dsa.PublicKey) ([]byte, error) {
+	params, err := asn1.Marshal(struct{ P, Q, G *big.Int }{pub.P, pub.Q, pub.G})
+	if err != nil {
+		return nil, err
+	}
+	y, err := asn1.Marshal(pub.Y)
+	if err != nil {
+		return nil, err
+	}
+	type publicKeyInfo struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	return asn1.Marshal(publicKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  asn1.ObjectIdentifier{1, 2, 840, 10040, 4, 1},
+			Parameters: asn1.RawValue{FullBytes: params},
+		},
+		PublicKey: asn1.BitString{Bytes: y, BitLength: len(y) * 8},
+	})
+}
+
+func lp(b []byte) []byte {
+	out := make([]byte, 4+len(b))
+	binary.LittleEndian.PutUint32(out, uint32(len(b)))
+	copy(out[4:], b)
+	return out
+}
+
+func leU32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return b
+}
+
+func TestFindEOCD(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("hello.txt")
+	w.Write([]byte("hello"))
+	// A comment containing EOCD-signature-like bytes must not be mistaken
+	// for the real record.
+	zw.SetComment(string([]byte{0x50, 0x4b, 0x05, 0x06, 0, 0, 0, 0}))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cdOffset, cdSize, eocd, eocdOffset, err := findEOCD(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("findEOCD: %v", err)
+	}
+	if cdOffset <= 0 || cdOffset >= int64(buf.Len()) {
+		t.Fatalf("implausible cdOffset: %d", cdOffset)
+	}
+	if cdSize <= 0 {
+		t.Fatalf("implausible cdSize: %d", cdSize)
+	}
+	if eocdOffset+int64(len(eocd)) != int64(buf.Len()) {
+		t.Fatalf("eocd record does not reach end of file: eocdOffset=%d len=%d total=%d", eocdOffset, len(eocd), buf.Len())
+	}
+	if string(eocd[:4]) != "PK\x05\x06" {
+		t.Fatalf("eocd record does not start with the EOCD signature: %x", eocd[:4])
+	}
+}
+
+func TestFindEOCDNotFound(t *testing.T) {
+	_, _, _, _, err := findEOCD(bytes.NewReader([]byte("not a zip file")), 14)
+	if err == nil {
+		t.Fatal("expected an error for a buffer with no EOCD record")
+	}
+}
+
+func TestComputeApkDigest(t *testing.T) {
+	small := bytes.Repeat([]byte("a"), 10)
+	// Larger than apkChunkSize so computeApkDigest must split it into two
+	// chunks rather than hashing it as one.
+	large := bytes.Repeat([]byte("b"), apkChunkSize+10)
+
+	got, err := computeApkDigest(sha256.New, bytes.NewReader(small), bytes.NewReader(large))
+	if err != nil {
+		t.Fatalf("computeApkDigest: %v", err)
+	}
+
+	// Recompute by hand following the CONTENT_DIGEST_CHUNKED_SHA256 spec.
+	chunkDigest := func(chunk []byte) []byte {
+		h := sha256.New()
+		h.Write([]byte{0xa5})
+		var lenBuf [4]byte
+		binary.LittleEndian.PutUint32(lenBuf[:], uint32(len(chunk)))
+		h.Write(lenBuf[:])
+		h.Write(chunk)
+		return h.Sum(nil)
+	}
+	var chunkDigests []byte
+	chunkDigests = append(chunkDigests, chunkDigest(small)...)
+	chunkDigests = append(chunkDigests, chunkDigest(large[:apkChunkSize])...)
+	chunkDigests = append(chunkDigests, chunkDigest(large[apkChunkSize:])...)
+
+	top := sha256.New()
+	top.Write([]byte{0x5a})
+	var countBuf [4]byte
+	binary.LittleEndian.PutUint32(countBuf[:], 3)
+	top.Write(countBuf[:])
+	top.Write(chunkDigests)
+	want := top.Sum(nil)
+
+	if !bytes.Equal(got, want) {
+		t.Fatalf("computeApkDigest mismatch:\ngot:  %x\nwant: %x", got, want)
+	}
+}
+
+// buildSignedApk assembles a zip with a single v2-scheme signer and returns
+// its bytes. sign is handed the signer's signed-data bytes and returns the
+// signature algorithm ID, the signature over them, and the PKIX-encoded
+// public key to embed in the signer record.
+func buildSignedApk(t *testing.T, sign func(signedData []byte) (algorithm uint32, sig, pubKeyDER []byte)) []byte {
+	t.Helper()
+
+	var zipBuf bytes.Buffer
+	zw := zip.NewWriter(&zipBuf)
+	w, _ := zw.Create("hello.txt")
+	w.Write([]byte("hello world, this is apk content"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zipBytes := zipBuf.Bytes()
+
+	eocdIdx := bytes.LastIndex(zipBytes, []byte{0x50, 0x4b, 0x05, 0x06})
+	if eocdIdx < 0 {
+		t.Fatal("no eocd in generated zip")
+	}
+	cdOffsetOrig := int64(binary.LittleEndian.Uint32(zipBytes[eocdIdx+16 : eocdIdx+20]))
+	cdSize := int64(binary.LittleEndian.Uint32(zipBytes[eocdIdx+12 : eocdIdx+16]))
+	contents := zipBytes[:cdOffsetOrig]
+	centralDir := zipBytes[cdOffsetOrig : cdOffsetOrig+cdSize]
+	eocd := append([]byte{}, zipBytes[eocdIdx:]...)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Test Signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour * 24 * 365),
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blockStart := int64(len(contents))
+	patchedEOCD := append([]byte{}, eocd...)
+	binary.LittleEndian.PutUint32(patchedEOCD[16:20], uint32(blockStart))
+
+	digest, err := computeApkDigest(sha256.New, bytes.NewReader(contents), bytes.NewReader(centralDir), bytes.NewReader(patchedEOCD))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digestEntry := append(append([]byte{}, leU32(0x0201)...), lp(digest)...)
+	digestSeq := lp(lp(digestEntry))
+	certSeq := lp(lp(certDER))
+	additionalAttrs := lp(nil)
+	signedData := append(append(append([]byte{}, digestSeq...), certSeq...), additionalAttrs...)
+
+	algorithm, sig, pubKeyDER := sign(signedData)
+
+	sigRecord := append(append([]byte{}, leU32(algorithm)...), lp(sig)...)
+	signaturesSeq := lp(lp(sigRecord))
+	pubKeyBlob := lp(pubKeyDER)
+
+	signer := append(append(append([]byte{}, lp(signedData)...), signaturesSeq...), pubKeyBlob...)
+	signerSeq := lp(signer)
+	v2Value := lp(signerSeq)
+
+	idAndValue := append(leU32(sigSchemeV2BlockID), v2Value...)
+	var entryLenBuf [8]byte
+	binary.LittleEndian.PutUint64(entryLenBuf[:], uint64(len(idAndValue)))
+	pairEntry := append(entryLenBuf[:], idAndValue...)
+
+	blockContentLen := uint64(len(pairEntry) + 24)
+	var sizeBuf [8]byte
+	binary.LittleEndian.PutUint64(sizeBuf[:], blockContentLen)
+
+	var sigBlock bytes.Buffer
+	sigBlock.Write(sizeBuf[:])
+	sigBlock.Write(pairEntry)
+	sigBlock.Write(sizeBuf[:])
+	sigBlock.Write(apkSigBlockMagic)
+
+	newCDOffset := int64(len(contents)) + int64(sigBlock.Len())
+	finalEOCD := append([]byte{}, eocd...)
+	binary.LittleEndian.PutUint32(finalEOCD[16:20], uint32(newCDOffset))
+
+	var final bytes.Buffer
+	final.Write(contents)
+	final.Write(sigBlock.Bytes())
+	final.Write(centralDir)
+	final.Write(finalEOCD)
+	return final.Bytes()
+}
+
+func openAppInfo(t *testing.T, apkBytes []byte) *AppInfo {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "signed.apk")
+	if err := os.WriteFile(path, apkBytes, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	stat, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &AppInfo{ext: androidExt, raw: f, Size: stat.Size()}
+}
+
+func TestAndroidSignaturesV2(t *testing.T) {
+	cases := []struct {
+		name string
+		sign func(signedData []byte) (algorithm uint32, sig, pubKeyDER []byte)
+	}{
+		{
+			name: "ecdsa-sha256",
+			sign: func(signedData []byte) (uint32, []byte, []byte) {
+				key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+				if err != nil {
+					t.Fatal(err)
+				}
+				h := sha256.Sum256(signedData)
+				sig, err := ecdsa.SignASN1(rand.Reader, key, h[:])
+				if err != nil {
+					t.Fatal(err)
+				}
+				pubKeyDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return 0x0201, sig, pubKeyDER
+			},
+		},
+		{
+			name: "rsa-pkcs1v15-sha256",
+			sign: func(signedData []byte) (uint32, []byte, []byte) {
+				key, err := rsa.GenerateKey(rand.Reader, 2048)
+				if err != nil {
+					t.Fatal(err)
+				}
+				h := sha256.Sum256(signedData)
+				sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, h[:])
+				if err != nil {
+					t.Fatal(err)
+				}
+				pubKeyDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return 0x0103, sig, pubKeyDER
+			},
+		},
+		{
+			name: "dsa-sha256",
+			sign: func(signedData []byte) (uint32, []byte, []byte) {
+				var params dsa.Parameters
+				if err := dsa.GenerateParameters(&params, rand.Reader, dsa.L1024N160); err != nil {
+					t.Fatal(err)
+				}
+				key := &dsa.PrivateKey{PublicKey: dsa.PublicKey{Parameters: params}}
+				if err := dsa.GenerateKey(key, rand.Reader); err != nil {
+					t.Fatal(err)
+				}
+				h := sha256.Sum256(signedData)
+				r, s, err := dsa.Sign(rand.Reader, key, h[:])
+				if err != nil {
+					t.Fatal(err)
+				}
+				sig, err := asn1.Marshal(dsaSignature{R: r, S: s})
+				if err != nil {
+					t.Fatal(err)
+				}
+				pubKeyDER, err := marshalDSAPublicKey(&key.PublicKey)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return 0x0301, sig, pubKeyDER
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			apkBytes := buildSignedApk(t, c.sign)
+			a := openAppInfo(t, apkBytes)
+
+			sigs, err := a.AndroidSignatures()
+			if err != nil {
+				t.Fatalf("AndroidSignatures: %v", err)
+			}
+			if len(sigs) != 1 {
+				t.Fatalf("expected 1 signature, got %d", len(sigs))
+			}
+			if sigs[0].Scheme != 2 {
+				t.Fatalf("expected scheme 2, got %d", sigs[0].Scheme)
+			}
+			if !sigs[0].Verified {
+				t.Fatal("expected signature to verify")
+			}
+			if len(sigs[0].Certificates) != 1 {
+				t.Fatalf("expected 1 certificate, got %d", len(sigs[0].Certificates))
+			}
+		})
+	}
+}
+
+// TestAndroidSignaturesV2Tampered is the adversarial counterpart to
+// TestAndroidSignaturesV2: a signature is only meaningful if modifying the
+// signed content after the fact makes it fail.
+func TestAndroidSignaturesV2Tampered(t *testing.T) {
+	sign := func(signedData []byte) (uint32, []byte, []byte) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := sha256.Sum256(signedData)
+		sig, err := ecdsa.SignASN1(rand.Reader, key, h[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		pubKeyDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return 0x0201, sig, pubKeyDER
+	}
+
+	apkBytes := buildSignedApk(t, sign)
+	// Flip a byte of the first zip entry's local file header (its
+	// modification time), well before the signing block, so the recomputed
+	// content digest no longer matches the one the (still internally
+	// self-consistent) signature covers.
+	apkBytes[10] ^= 0xff
+
+	a := openAppInfo(t, apkBytes)
+	sigs, err := a.AndroidSignatures()
+	if err != nil {
+		t.Fatalf("AndroidSignatures: %v", err)
+	}
+	if len(sigs) != 1 {
+		t.Fatalf("expected 1 signature, got %d", len(sigs))
+	}
+	if sigs[0].Verified {
+		t.Fatal("expected tampered APK to fail verification")
+	}
+}